@@ -1,37 +1,30 @@
 package importer
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 
+	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
-	kapi "k8s.io/kubernetes/pkg/apis/core"
 	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
 	kcmdutil "k8s.io/kubernetes/pkg/kubectl/cmd/util"
 	"k8s.io/kubernetes/pkg/kubectl/genericclioptions"
-	"k8s.io/kubernetes/pkg/kubectl/genericclioptions/printers"
-	"k8s.io/kubernetes/pkg/kubectl/genericclioptions/resource"
 
 	configcmd "github.com/openshift/origin/pkg/bulk"
 	"github.com/openshift/origin/pkg/oc/generate/app"
 	"github.com/openshift/origin/pkg/oc/generate/appjson"
-	appcmd "github.com/openshift/origin/pkg/oc/generate/cmd"
-	"github.com/openshift/origin/pkg/oc/util/ocscheme"
-	templateinternalclient "github.com/openshift/origin/pkg/template/client/internalversion"
-	templateclientinternal "github.com/openshift/origin/pkg/template/generated/internalclientset"
-	templateclient "github.com/openshift/origin/pkg/template/generated/internalclientset/typed/template/internalversion"
+	"github.com/openshift/origin/pkg/oc/generate/chart"
+	"github.com/openshift/origin/pkg/oc/generate/overlay"
+	templateapi "github.com/openshift/origin/pkg/template/apis/template"
 )
 
 const AppJSONV1GeneratorName = "app-json/v1"
@@ -41,12 +34,25 @@ var (
 		Import app.json files as OpenShift objects
 
 		app.json defines the pattern of a simple, stateless web application that can be horizontally scaled.
-		This command will transform a provided app.json object into its OpenShift equivalent.
-		During transformation fields in the app.json syntax that are not relevant when running on top of
-		a containerized platform will be ignored and a warning printed.
+		This command will transform a provided app.json object into its OpenShift equivalent, including
+		addons, per-environment overrides (test, review, production - select one with --environment),
+		process formations, and postdeploy scripts. Fields in the app.json syntax that have no
+		OpenShift equivalent will be ignored and a warning printed.
+
+		Use --values and --set to override Template parameters or individual object fields at
+		import time, the way a Helm chart accepts values overrides.
+
+		Pass --addon-catalog to resolve app.json "addons" entries against Templates instead of the
+		default placeholder Secret, keyed by the addon's plan string.
 
 		The command will create objects unless you pass the -o yaml or --as-template flags to generate a
-		configuration file for later use.
+		configuration file for later use, or --as-chart/--as-oci to distribute the result as a Helm v3
+		chart instead.
+
+		Pass --reconcile to make re-running the import against an existing app idempotent: objects are
+		applied with server-side apply (or a client-side merge fallback on older clusters) instead of
+		failing when they already exist. Add --prune to also delete objects a previous import of the
+		same app.json created that are no longer part of it.
 
 		Experimental: This command is under active development and may change without notice.`)
 
@@ -55,38 +61,32 @@ var (
 	  $ %[1]s app.json -f .
 
 	  # Turn an app.json file into a template
-	  $ %[1]s app.json -f ./app.json -o yaml --as-template`)
+	  $ %[1]s app.json -f ./app.json -o yaml --as-template
+
+	  # Generate a template named web, overriding a parameter and scaling its deployment up
+	  $ %[1]s app.json -f ./app.json -o yaml --as-template web --set NODE_ENV=production,deploymentconfigs.web.spec.replicas=3`)
 )
 
 type AppJSONOptions struct {
-	PrintFlags *genericclioptions.PrintFlags
-
-	Printer printers.ResourcePrinter
-
-	bulkAction configcmd.BulkAction
-
-	BaseImage        string
-	Generator        string
-	AsTemplate       string
-	OutputVersionStr string
-
-	OutputVersions []schema.GroupVersion
-
-	Namespace string
-	Client    templateclient.TemplateInterface
-
-	genericclioptions.IOStreams
-	resource.FilenameOptions
+	importerOptions
+
+	BaseImage            string
+	Generator            string
+	Environment          string
+	ValuesFilename       string
+	Set                  []string
+	AddonCatalogFilename string
+	AsChartDir           string
+	AsOCIRef             string
+	Reconcile            bool
+	ServerSide           bool
+	Prune                bool
 }
 
 func NewAppJSONOptions(streams genericclioptions.IOStreams) *AppJSONOptions {
 	return &AppJSONOptions{
-		bulkAction: configcmd.BulkAction{
-			IOStreams: streams,
-		},
-		IOStreams:  streams,
-		PrintFlags: genericclioptions.NewPrintFlags("created").WithTypeSetter(ocscheme.PrintingInternalScheme),
-		Generator:  AppJSONV1GeneratorName,
+		importerOptions: newImporterOptions(streams),
+		Generator:       AppJSONV1GeneratorName,
 	}
 }
 
@@ -112,6 +112,15 @@ func NewCmdAppJSON(fullName string, f kcmdutil.Factory, streams genericclioption
 	cmd.Flags().StringVar(&o.Generator, "generator", o.Generator, "The name of the generator strategy to use - specify this value to for backwards compatibility.")
 	cmd.Flags().StringVar(&o.AsTemplate, "as-template", o.AsTemplate, "If set, generate a template with the provided name")
 	cmd.Flags().StringVar(&o.OutputVersionStr, "output-version", o.OutputVersionStr, "The preferred API versions of the output objects")
+	cmd.Flags().StringVar(&o.Environment, "environment", o.Environment, "The environments entry (e.g. test, review, production) to apply from app.json, if any")
+	cmd.Flags().StringVar(&o.ValuesFilename, "values", o.ValuesFilename, "A YAML or JSON file of values that override Template parameters and object fields, as with --set")
+	cmd.Flags().StringVar(&o.AddonCatalogFilename, "addon-catalog", o.AddonCatalogFilename, "A YAML or JSON file mapping addon plan names (e.g. heroku-postgresql:hobby-dev) to a Template to instantiate in their place; addons with no matching entry become a placeholder Secret")
+	cmd.Flags().StringSliceVar(&o.Set, "set", o.Set, "Set a parameter or object field value, e.g. --set foo=bar,deploymentconfigs.web.spec.replicas=3 (can be repeated)")
+	cmd.Flags().StringVar(&o.AsChartDir, "as-chart", o.AsChartDir, "If set, write a Helm v3 chart to this directory instead of creating objects")
+	cmd.Flags().StringVar(&o.AsOCIRef, "as-oci", o.AsOCIRef, "If set, push a Helm v3 chart as an OCI artifact to this reference (host/repository:tag) instead of creating objects")
+	cmd.Flags().BoolVar(&o.Reconcile, "reconcile", o.Reconcile, "Apply objects idempotently instead of failing when they already exist, using server-side apply with a client-side merge fallback")
+	cmd.Flags().BoolVar(&o.ServerSide, "server-side", o.ServerSide, "With --reconcile, require server-side apply and fail instead of falling back on clusters that don't support it")
+	cmd.Flags().BoolVar(&o.Prune, "prune", o.Prune, "With --reconcile, delete previously imported objects that are no longer part of this app.json")
 	o.bulkAction.BindForOutput(cmd.Flags(), "output", "template")
 	o.PrintFlags.AddFlags(cmd)
 
@@ -119,46 +128,16 @@ func NewCmdAppJSON(fullName string, f kcmdutil.Factory, streams genericclioption
 }
 
 func (o *AppJSONOptions) Complete(f kcmdutil.Factory, cmd *cobra.Command, args []string) error {
-	for _, v := range strings.Split(o.OutputVersionStr, ",") {
-		gv, err := schema.ParseGroupVersion(v)
-		if err != nil {
-			return fmt.Errorf("provided output-version %q is not valid: %v", v, err)
-		}
-		o.OutputVersions = append(o.OutputVersions, gv)
-	}
-	o.OutputVersions = append(o.OutputVersions, legacyscheme.Scheme.PrioritizedVersionsAllGroups()...)
-
-	restMapper, err := f.ToRESTMapper()
-	if err != nil {
-		return err
-	}
-	clientConfig, err := f.ToRESTConfig()
-	if err != nil {
+	if err := o.complete(f); err != nil {
 		return err
 	}
-	dynamicClient, err := dynamic.NewForConfig(clientConfig)
-	o.bulkAction.Bulk.Scheme = legacyscheme.Scheme
-	o.bulkAction.Bulk.Op = configcmd.Creator{
-		Client:     dynamicClient,
-		RESTMapper: restMapper,
-	}.Create
-
-	o.Printer, err = o.PrintFlags.ToPrinter()
-	if err != nil {
-		return err
-	}
-
-	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
-	if err != nil {
-		return err
-	}
-
-	templateClient, err := templateclientinternal.NewForConfig(clientConfig)
-	if err != nil {
-		return err
+	if o.Reconcile {
+		o.bulkAction.Bulk.Op = configcmd.Reconciler{
+			Client:     o.Dynamic,
+			RESTMapper: o.RESTMapper,
+			ServerSide: o.ServerSide,
+		}.Patch
 	}
-	o.Client = templateClient.Template()
-
 	return nil
 }
 
@@ -171,6 +150,9 @@ func (o *AppJSONOptions) Validate() error {
 	default:
 		return fmt.Errorf("the generator %q is not supported, use: %s", o.Generator, AppJSONV1GeneratorName)
 	}
+	if (o.ServerSide || o.Prune) && !o.Reconcile {
+		return fmt.Errorf("--server-side and --prune only apply with --reconcile")
+	}
 	return nil
 }
 
@@ -180,9 +162,16 @@ func (o *AppJSONOptions) Run() error {
 		return err
 	}
 
+	catalog, err := o.addonCatalog()
+	if err != nil {
+		return err
+	}
+
 	g := &appjson.Generator{
-		LocalPath: localPath,
-		BaseImage: o.BaseImage,
+		LocalPath:    localPath,
+		BaseImage:    o.BaseImage,
+		Environment:  o.Environment,
+		AddonCatalog: catalog,
 	}
 	switch {
 	case len(o.AsTemplate) > 0:
@@ -200,81 +189,144 @@ func (o *AppJSONOptions) Run() error {
 	if err != nil {
 		return err
 	}
+	for _, warning := range g.Warnings {
+		fmt.Fprintf(o.bulkAction.ErrOut, "warning: %s\n", warning)
+	}
 
 	template.ObjectLabels = map[string]string{"app.json": template.Name}
 
-	// all the types generated into the template should be known
+	values, err := o.values()
+	if err != nil {
+		return err
+	}
+	overlay.ApplyParameters(template, values)
+
+	// all the types generated into the template should be known; do this
+	// before the object overlay and chart/OCI output so that TypeMeta.Kind
+	// is populated for both to key off of.
 	if errs := app.AsVersionedObjects(template.Objects, legacyscheme.Scheme, legacyscheme.Scheme, o.OutputVersions...); len(errs) > 0 {
 		for _, err := range errs {
 			fmt.Fprintf(o.bulkAction.ErrOut, "error: %v\n", err)
 		}
 	}
+	if template.Objects, err = overlay.ApplyObjects(template.Objects, values); err != nil {
+		return err
+	}
 
-	if o.bulkAction.ShouldPrint() || (o.bulkAction.Output == "name" && len(o.AsTemplate) > 0) {
-		var obj runtime.Object
-		if len(o.AsTemplate) > 0 {
-			template.Name = o.AsTemplate
-			obj = template
-		} else {
-			obj = &kapi.List{Items: template.Objects}
+	if len(o.AsChartDir) > 0 {
+		return chart.Write(o.AsChartDir, template)
+	}
+	if len(o.AsOCIRef) > 0 {
+		chartDir, err := ioutil.TempDir("", "oc-import-chart")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(chartDir)
+		if err := chart.Write(chartDir, template); err != nil {
+			return err
 		}
-		return o.Printer.PrintObj(obj, o.Out)
+		return chart.PushOCI(o.AsOCIRef, chartDir)
 	}
 
-	templateProcessor := templateinternalclient.NewTemplateProcessorClient(o.Client.RESTClient(), o.Namespace)
-	result, err := appcmd.TransformTemplate(template, templateProcessor, o.Namespace, nil, false)
+	result, err := o.printOrApply(template, "Importing app.json")
 	if err != nil {
 		return err
 	}
 
-	if o.bulkAction.Verbose() {
-		appcmd.DescribeGeneratedTemplate(o.bulkAction.Out, "", result, o.Namespace)
-	}
-
-	if errs := o.bulkAction.WithMessage("Importing app.json", "creating").Run(&kapi.List{Items: result.Objects}, o.Namespace); len(errs) > 0 {
-		return kcmdutil.ErrExit
+	if o.Prune && result != nil {
+		if err := o.prune(template.Name, result.Objects); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func contentsForPathOrURL(s string, in io.Reader, subpaths ...string) (string, []byte, error) {
-	switch {
-	case s == "-":
-		contents, err := ioutil.ReadAll(in)
-		return "", contents, err
-	case strings.Index(s, "http://") == 0 || strings.Index(s, "https://") == 0:
-		_, err := url.Parse(s)
+// prune removes objects left over from a previous import: anything in the
+// app's namespace carrying this import's "app.json" label that isn't part
+// of the current object set. It reuses the GroupVersionKind of each
+// generated object to decide which resources to list, so it only prunes
+// kinds the current import actually produces. keep is indexed by resource
+// as well as name, since e.g. the DeploymentConfig and Service generated
+// for the same process share a name.
+func (o *AppJSONOptions) prune(appName string, objects []runtime.Object) error {
+	keep := map[schema.GroupVersionResource]map[string]bool{}
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
 		if err != nil {
-			return "", nil, fmt.Errorf("the URL passed to filename %q is not valid: %v", s, err)
+			return err
 		}
-		res, err := http.Get(s)
+
+		mapping, err := o.RESTMapper.RESTMapping(obj.GetObjectKind().GroupVersionKind().GroupKind(), obj.GetObjectKind().GroupVersionKind().Version)
 		if err != nil {
-			return "", nil, err
+			return err
 		}
-		defer res.Body.Close()
-		contents, err := ioutil.ReadAll(res.Body)
-		return "", contents, err
-	default:
-		stat, err := os.Stat(s)
+		if keep[mapping.Resource] == nil {
+			keep[mapping.Resource] = map[string]bool{}
+		}
+		keep[mapping.Resource][accessor.GetName()] = true
+	}
+
+	var gvrs []schema.GroupVersionResource
+	for gvr := range keep {
+		gvrs = append(gvrs, gvr)
+	}
+
+	ownerLabel := fmt.Sprintf("app.json=%s", appName)
+	return configcmd.Prune(o.Dynamic, gvrs, o.Namespace, ownerLabel, keep)
+}
+
+// values combines --values and --set into a single overlay, --set taking
+// precedence on any key the two disagree on - the same precedence Helm
+// gives its own --values/--set flags.
+func (o *AppJSONOptions) values() (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(o.ValuesFilename) > 0 {
+		contents, err := ioutil.ReadFile(o.ValuesFilename)
 		if err != nil {
-			return s, nil, err
+			return nil, fmt.Errorf("unable to read --values file: %v", err)
 		}
-		if !stat.IsDir() {
-			contents, err := ioutil.ReadFile(s)
-			return s, contents, err
+		fileValues, err := overlay.ParseValues(contents)
+		if err != nil {
+			return nil, err
+		}
+		values = overlay.Merge(values, fileValues)
+	}
+	setValues, err := overlay.ParseSet(o.Set)
+	if err != nil {
+		return nil, err
+	}
+	return overlay.Merge(values, setValues), nil
+}
+
+// addonCatalog reads --addon-catalog, a YAML or JSON document whose keys are
+// addon plan strings and whose values are Template manifests, into the map
+// appjson.Generator.AddonCatalog expects. It returns a nil map, not an
+// error, when --addon-catalog wasn't passed, so every addon falls back to
+// the generator's placeholder-Secret behavior as before.
+func (o *AppJSONOptions) addonCatalog() (map[string]*templateapi.Template, error) {
+	if len(o.AddonCatalogFilename) == 0 {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(o.AddonCatalogFilename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read --addon-catalog file: %v", err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("--addon-catalog file is not valid YAML or JSON: %v", err)
+	}
+
+	catalog := make(map[string]*templateapi.Template, len(raw))
+	for plan, data := range raw {
+		obj, gvk, err := legacyscheme.Codecs.UniversalDecoder().Decode(data, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("--addon-catalog entry %q is not a valid Template: %v", plan, err)
 		}
-		for _, sub := range subpaths {
-			path := filepath.Join(s, sub)
-			stat, err := os.Stat(path)
-			if err != nil {
-				continue
-			}
-			if stat.IsDir() {
-				continue
-			}
-			contents, err := ioutil.ReadFile(s)
-			return path, contents, err
+		tmpl, ok := obj.(*templateapi.Template)
+		if !ok {
+			return nil, fmt.Errorf("--addon-catalog entry %q decoded as %s, expected a Template", plan, gvk)
 		}
-		return s, nil, os.ErrNotExist
+		catalog[plan] = tmpl
 	}
+	return catalog, nil
 }
@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	kapi "k8s.io/kubernetes/pkg/apis/core"
+	kcmdutil "k8s.io/kubernetes/pkg/kubectl/cmd/util"
+	"k8s.io/kubernetes/pkg/kubectl/genericclioptions"
+	"k8s.io/kubernetes/pkg/kubectl/genericclioptions/printers"
+	"k8s.io/kubernetes/pkg/kubectl/genericclioptions/resource"
+
+	configcmd "github.com/openshift/origin/pkg/bulk"
+	appcmd "github.com/openshift/origin/pkg/oc/generate/cmd"
+	"github.com/openshift/origin/pkg/oc/util/ocscheme"
+	templateapi "github.com/openshift/origin/pkg/template/apis/template"
+	templateinternalclient "github.com/openshift/origin/pkg/template/client/internalversion"
+	templateclientinternal "github.com/openshift/origin/pkg/template/generated/internalclientset"
+	templateclient "github.com/openshift/origin/pkg/template/generated/internalclientset/typed/template/internalversion"
+)
+
+// importerOptions holds the CLI plumbing every "oc import" subcommand
+// shares - print/create flags, output-version parsing, and the client and
+// REST mapper needed to either print a Template or instantiate and create
+// it. Each importer (AppJSONOptions, ComposeOptions) embeds this and adds
+// the flags and Generator specific to its source format.
+type importerOptions struct {
+	PrintFlags *genericclioptions.PrintFlags
+
+	Printer printers.ResourcePrinter
+
+	bulkAction configcmd.BulkAction
+
+	AsTemplate       string
+	OutputVersionStr string
+
+	OutputVersions []schema.GroupVersion
+
+	Namespace  string
+	Client     templateclient.TemplateInterface
+	RESTMapper meta.RESTMapper
+	Dynamic    dynamic.Interface
+
+	genericclioptions.IOStreams
+	resource.FilenameOptions
+}
+
+func newImporterOptions(streams genericclioptions.IOStreams) importerOptions {
+	return importerOptions{
+		bulkAction: configcmd.BulkAction{
+			IOStreams: streams,
+		},
+		IOStreams:  streams,
+		PrintFlags: genericclioptions.NewPrintFlags("created").WithTypeSetter(ocscheme.PrintingInternalScheme),
+	}
+}
+
+// complete resolves the REST mapper, dynamic client, printer, namespace and
+// template client every importer needs, and defaults bulkAction.Bulk.Op to
+// plain object creation. Callers that support --reconcile override Bulk.Op
+// afterward.
+func (o *importerOptions) complete(f kcmdutil.Factory) error {
+	for _, v := range strings.Split(o.OutputVersionStr, ",") {
+		gv, err := schema.ParseGroupVersion(v)
+		if err != nil {
+			return fmt.Errorf("provided output-version %q is not valid: %v", v, err)
+		}
+		o.OutputVersions = append(o.OutputVersions, gv)
+	}
+	o.OutputVersions = append(o.OutputVersions, legacyscheme.Scheme.PrioritizedVersionsAllGroups()...)
+
+	restMapper, err := f.ToRESTMapper()
+	if err != nil {
+		return err
+	}
+	clientConfig, err := f.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		return err
+	}
+	o.RESTMapper = restMapper
+	o.Dynamic = dynamicClient
+
+	o.bulkAction.Bulk.Scheme = legacyscheme.Scheme
+	o.bulkAction.Bulk.Op = configcmd.Creator{
+		Client:     dynamicClient,
+		RESTMapper: restMapper,
+	}.Create
+
+	o.Printer, err = o.PrintFlags.ToPrinter()
+	if err != nil {
+		return err
+	}
+
+	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	templateClient, err := templateclientinternal.NewForConfig(clientConfig)
+	if err != nil {
+		return err
+	}
+	o.Client = templateClient.Template()
+
+	return nil
+}
+
+// printOrApply either prints template (as a Template if --as-template was
+// given, otherwise as a List of its objects) when the caller asked for
+// output instead of creation, or instantiates it against the server and
+// runs bulkAction against the result, labeled with the given progress verb
+// (e.g. "Importing app.json"). It returns the instantiated objects so
+// callers that support --prune can compare against them; a nil result means
+// the template was printed rather than created.
+func (o *importerOptions) printOrApply(template *templateapi.Template, progressMessage string) (*templateapi.Template, error) {
+	if o.bulkAction.ShouldPrint() || (o.bulkAction.Output == "name" && len(o.AsTemplate) > 0) {
+		var obj runtime.Object
+		if len(o.AsTemplate) > 0 {
+			template.Name = o.AsTemplate
+			obj = template
+		} else {
+			obj = &kapi.List{Items: template.Objects}
+		}
+		return nil, o.Printer.PrintObj(obj, o.Out)
+	}
+
+	templateProcessor := templateinternalclient.NewTemplateProcessorClient(o.Client.RESTClient(), o.Namespace)
+	result, err := appcmd.TransformTemplate(template, templateProcessor, o.Namespace, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.bulkAction.Verbose() {
+		appcmd.DescribeGeneratedTemplate(o.bulkAction.Out, "", result, o.Namespace)
+	}
+
+	if errs := o.bulkAction.WithMessage(progressMessage, "creating").Run(&kapi.List{Items: result.Objects}, o.Namespace); len(errs) > 0 {
+		return nil, kcmdutil.ErrExit
+	}
+	return result, nil
+}
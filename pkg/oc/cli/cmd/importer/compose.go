@@ -0,0 +1,142 @@
+package importer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	kcmdutil "k8s.io/kubernetes/pkg/kubectl/cmd/util"
+	"k8s.io/kubernetes/pkg/kubectl/genericclioptions"
+
+	"github.com/openshift/origin/pkg/oc/generate/app"
+	"github.com/openshift/origin/pkg/oc/generate/compose"
+)
+
+var (
+	composeLong = templates.LongDesc(`
+		Import a docker-compose file as OpenShift objects
+
+		docker-compose.yml describes a set of containers, their images, and how they are wired
+		together. This command will transform a provided compose file into its OpenShift
+		equivalent: a DeploymentConfig and, where the service declares a build, an ImageStream
+		and BuildConfig per service, a Service carrying the ports of each service that exposes
+		any, a PersistentVolumeClaim per named volume, and a Secret per compose
+		"secrets"/"configs" entry. network_mode: host and privileged, which have no OpenShift
+		equivalent, are ignored and a warning printed; other keys this command does not read
+		are ignored without a warning.
+
+		The command will create objects unless you pass the -o yaml or --as-template flags to generate a
+		configuration file for later use.
+
+		Experimental: This command is under active development and may change without notice.`)
+
+	composeExample = templates.Examples(`
+		# Import a docker-compose.yml in the current directory
+	  $ %[1]s compose -f docker-compose.yml
+
+	  # Turn a docker-compose.yml file into a template
+	  $ %[1]s compose -f ./docker-compose.yml -o yaml --as-template`)
+)
+
+// ComposeOptions holds the state for a single invocation of "oc import
+// compose". It embeds importerOptions, the plumbing shared with
+// AppJSONOptions, so the two importers behave consistently.
+type ComposeOptions struct {
+	importerOptions
+
+	BaseImage string
+}
+
+func NewComposeOptions(streams genericclioptions.IOStreams) *ComposeOptions {
+	return &ComposeOptions{
+		importerOptions: newImporterOptions(streams),
+	}
+}
+
+// NewCmdCompose imports a docker-compose file as a template.
+func NewCmdCompose(fullName string, f kcmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewComposeOptions(streams)
+	cmd := &cobra.Command{
+		Use:     "compose -f COMPOSEFILE",
+		Short:   "Import a docker-compose definition into OpenShift (experimental)",
+		Long:    composeLong,
+		Example: fmt.Sprintf(composeExample, fullName),
+		Run: func(cmd *cobra.Command, args []string) {
+			kcmdutil.CheckErr(o.Complete(f, cmd, args))
+			kcmdutil.CheckErr(o.Validate())
+			kcmdutil.CheckErr(o.Run())
+		},
+	}
+	usage := "Filename, directory, or URL to a docker-compose file to use"
+	kcmdutil.AddJsonFilenameFlag(cmd.Flags(), &o.Filenames, usage)
+	cmd.MarkFlagRequired("filename")
+	cmd.Flags().StringVar(&o.BaseImage, "image", o.BaseImage, "An optional image to use as your base Docker build (must have ONBUILD directives)")
+	cmd.Flags().StringVar(&o.AsTemplate, "as-template", o.AsTemplate, "If set, generate a template with the provided name")
+	cmd.Flags().StringVar(&o.OutputVersionStr, "output-version", o.OutputVersionStr, "The preferred API versions of the output objects")
+	o.bulkAction.BindForOutput(cmd.Flags(), "output", "template")
+	o.PrintFlags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *ComposeOptions) Complete(f kcmdutil.Factory, cmd *cobra.Command, args []string) error {
+	return o.complete(f)
+}
+
+func (o *ComposeOptions) Validate() error {
+	if len(o.Filenames) != 1 {
+		return fmt.Errorf("you must provide the path to a docker-compose file or directory containing one")
+	}
+	return nil
+}
+
+func (o *ComposeOptions) Run() error {
+	localPath, contents, err := contentsForPathOrURL(o.Filenames[0], o.In, "docker-compose.yml", "docker-compose.yaml")
+	if err != nil {
+		return err
+	}
+
+	g := &compose.Generator{
+		LocalPath: localPath,
+		BaseImage: o.BaseImage,
+	}
+	switch {
+	case len(o.AsTemplate) > 0:
+		g.Name = o.AsTemplate
+	case len(localPath) > 0:
+		dir := filepath.Dir(localPath)
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		g.Name = filepath.Base(dir)
+	default:
+		g.Name = path.Base(path.Dir(o.Filenames[0]))
+	}
+	if len(g.Name) == 0 {
+		g.Name = "app"
+	}
+
+	template, err := g.Generate(contents)
+	if err != nil {
+		return err
+	}
+	for _, warning := range g.Warnings {
+		fmt.Fprintf(o.bulkAction.ErrOut, "warning: %s\n", warning)
+	}
+
+	template.ObjectLabels = map[string]string{"docker-compose": template.Name}
+
+	// all the types generated into the template should be known
+	if errs := app.AsVersionedObjects(template.Objects, legacyscheme.Scheme, legacyscheme.Scheme, o.OutputVersions...); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(o.bulkAction.ErrOut, "error: %v\n", err)
+		}
+	}
+
+	_, err = o.printOrApply(template, "Importing docker-compose")
+	return err
+}
@@ -0,0 +1,324 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// maxRemoteFetchSize bounds how much of a remote response contentsForPathOrURL
+// will read, so an error page (or a redirect to one) can't be mistaken for a
+// small manifest file and silently treated as one.
+const maxRemoteFetchSize = 5 << 20 // 5MiB
+
+// SourceFetcher resolves a scheme-prefixed source reference (an app.json or
+// docker-compose file, whether local or remote) into its contents. Schemes
+// are registered once in init() so every importer's -f flag gets the same
+// set of remote sources for free.
+type SourceFetcher interface {
+	// Fetch returns the contents addressed by source. localPath is returned
+	// when the source resolves to something on local disk (so callers can
+	// use it to derive a default object name); it is empty for anything
+	// fetched over the network.
+	Fetch(source string, subpaths ...string) (localPath string, contents []byte, err error)
+}
+
+// fetchers is keyed by URI scheme (without "://"); "" is the fallback used
+// for local paths. "-" is read from stdin by contentsForPathOrURL itself.
+var fetchers = map[string]SourceFetcher{}
+
+func registerFetcher(scheme string, f SourceFetcher) {
+	fetchers[scheme] = f
+}
+
+func init() {
+	registerFetcher("", localFetcher{})
+	httpFetcher := &cachingHTTPFetcher{cacheDir: httpCacheDir()}
+	registerFetcher("http", httpFetcher)
+	registerFetcher("https", httpFetcher)
+	registerFetcher("git+https", gitFetcher{})
+	registerFetcher("git+http", gitFetcher{})
+	registerFetcher("s3", s3Fetcher{})
+	registerFetcher("oci", ociSourceFetcher{})
+}
+
+// contentsForPathOrURL resolves s (a local path, "-" for stdin, or a
+// scheme-prefixed remote reference) to its contents, trying subpaths in
+// order when s names a directory.
+func contentsForPathOrURL(s string, in io.Reader, subpaths ...string) (string, []byte, error) {
+	if s == "-" {
+		contents, err := ioutil.ReadAll(in)
+		return "", contents, err
+	}
+	scheme := schemeOf(s)
+	fetcher, ok := fetchers[scheme]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported source scheme %q in %q", scheme, s)
+	}
+	return fetcher.Fetch(s, subpaths...)
+}
+
+// schemeOf returns the registered scheme prefix of s (e.g. "git+https" for
+// "git+https://host/repo//path@ref", "http" for a plain URL), or "" for
+// anything that should be treated as a local path.
+func schemeOf(s string) string {
+	idx := strings.Index(s, "://")
+	if idx < 0 {
+		return ""
+	}
+	return s[:idx]
+}
+
+// localFetcher reads a local file or, for a directory, the first of
+// subpaths that exists within it.
+type localFetcher struct{}
+
+func (localFetcher) Fetch(s string, subpaths ...string) (string, []byte, error) {
+	stat, err := os.Stat(s)
+	if err != nil {
+		return s, nil, err
+	}
+	if !stat.IsDir() {
+		contents, err := ioutil.ReadFile(s)
+		return s, contents, err
+	}
+	for _, sub := range subpaths {
+		candidate := filepath.Join(s, sub)
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(candidate)
+		return candidate, contents, err
+	}
+	return s, nil, os.ErrNotExist
+}
+
+// cachingHTTPFetcher is a hardened http(s) fetcher: it checks the response
+// status, follows redirects up to Go's default limit while capping the
+// number of bytes read, and caches responses by ETag under cacheDir so a
+// re-import of an unchanged manifest doesn't refetch it. It relies on
+// net/http's default transport for HTTP(S)_PROXY support.
+type cachingHTTPFetcher struct {
+	cacheDir string
+}
+
+func (f *cachingHTTPFetcher) Fetch(s string, subpaths ...string) (string, []byte, error) {
+	cacheKey := fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+	cachedETag, cachedBody := f.readCache(cacheKey)
+
+	req, err := http.NewRequest(http.MethodGet, s, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("the URL passed to filename %q is not valid: %v", s, err)
+	}
+	if len(cachedETag) > 0 {
+		req.Header.Set("If-None-Match", cachedETag)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return "", cachedBody, nil
+	case http.StatusOK:
+	default:
+		return "", nil, fmt.Errorf("fetching %q returned status %s", s, res.Status)
+	}
+
+	contents, err := ioutil.ReadAll(io.LimitReader(res.Body, maxRemoteFetchSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(contents) > maxRemoteFetchSize {
+		return "", nil, fmt.Errorf("fetching %q exceeded the %d byte limit", s, maxRemoteFetchSize)
+	}
+
+	if etag := res.Header.Get("ETag"); len(etag) > 0 {
+		f.writeCache(cacheKey, etag, contents)
+	}
+	return "", contents, nil
+}
+
+func (f *cachingHTTPFetcher) readCache(key string) (etag string, body []byte) {
+	if len(f.cacheDir) == 0 {
+		return "", nil
+	}
+	etagBytes, err := ioutil.ReadFile(filepath.Join(f.cacheDir, key+".etag"))
+	if err != nil {
+		return "", nil
+	}
+	body, err = ioutil.ReadFile(filepath.Join(f.cacheDir, key+".body"))
+	if err != nil {
+		return "", nil
+	}
+	return string(etagBytes), body
+}
+
+func (f *cachingHTTPFetcher) writeCache(key, etag string, body []byte) {
+	if len(f.cacheDir) == 0 {
+		return
+	}
+	if err := os.MkdirAll(f.cacheDir, 0755); err != nil {
+		return
+	}
+	ioutil.WriteFile(filepath.Join(f.cacheDir, key+".etag"), []byte(etag), 0644)
+	ioutil.WriteFile(filepath.Join(f.cacheDir, key+".body"), body, 0644)
+}
+
+func httpCacheDir() string {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if len(base) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(base, "oc", "importer")
+}
+
+// gitFetcher resolves "git+https://host/repo//subpath@ref" references by
+// shallow-cloning the repo at ref into a temporary directory and reading
+// subpath out of it.
+type gitFetcher struct{}
+
+func (gitFetcher) Fetch(s string, subpaths ...string) (string, []byte, error) {
+	repoURL, ref, subpath, err := parseGitSource(s)
+	if err != nil {
+		return "", nil, err
+	}
+	// repoURL and ref come straight from the user-supplied -f source; reject
+	// anything that could be mistaken for a git flag (e.g.
+	// "--upload-pack=...") instead of a positional argument.
+	if strings.HasPrefix(repoURL, "-") {
+		return "", nil, fmt.Errorf("invalid git source %q: repository %q must not begin with \"-\"", s, repoURL)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", nil, fmt.Errorf("invalid git source %q: ref %q must not begin with \"-\"", s, ref)
+	}
+
+	dir, err := ioutil.TempDir("", "oc-import-git")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	clone := exec.Command("git", "clone", "--depth", "1", "--branch", ref, "--", repoURL, dir)
+	if out, err := clone.CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("unable to clone %q at %q: %v\n%s", repoURL, ref, err, out)
+	}
+
+	if len(subpath) > 0 {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, subpath))
+		return "", contents, err
+	}
+	return localFetcher{}.Fetch(dir, subpaths...)
+}
+
+// parseGitSource splits "git+https://host/repo//subpath@ref" into the
+// cloneable repo URL, the ref to check out (defaulting to "master"), and
+// the subpath within the repo to read.
+func parseGitSource(s string) (repoURL, ref, subpath string, err error) {
+	rest := strings.TrimPrefix(s, "git+")
+	ref = "master"
+	if idx := strings.LastIndex(rest, "@"); idx >= 0 {
+		ref = rest[idx+1:]
+		rest = rest[:idx]
+	}
+	if idx := strings.Index(rest, "//"); idx >= 0 {
+		schemeEnd := strings.Index(rest, "://") + 3
+		if sep := strings.Index(rest[schemeEnd:], "//"); sep >= 0 {
+			subpath = rest[schemeEnd+sep+2:]
+			rest = rest[:schemeEnd+sep]
+		}
+	}
+	if len(rest) == 0 {
+		return "", "", "", fmt.Errorf("invalid git source %q", s)
+	}
+	return rest, ref, subpath, nil
+}
+
+// s3Fetcher resolves "s3://bucket/key" references. It only supports
+// publicly readable objects via the virtual-hosted-style HTTPS endpoint;
+// private buckets need credentials this package doesn't carry a dependency
+// for and should be fetched out of band.
+type s3Fetcher struct{}
+
+func (s3Fetcher) Fetch(s string, subpaths ...string) (string, []byte, error) {
+	rest := strings.TrimPrefix(s, "s3://")
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid s3 source %q, expected s3://bucket/key", s)
+	}
+	bucket, key := parts[0], parts[1]
+	url := fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, key)
+	httpFetcher := fetchers["https"]
+	return httpFetcher.Fetch(url, subpaths...)
+}
+
+// ociSourceFetcher resolves "oci://registry/repository:tag" references by
+// pulling the artifact manifest and reading the blob it names as config.
+// The manifest's layers are not read, so a chart pushed by the chart
+// package's PushOCI (chart in a layer, "{}" as config) yields "{}".
+type ociSourceFetcher struct{}
+
+func (ociSourceFetcher) Fetch(s string, subpaths ...string) (string, []byte, error) {
+	rest := strings.TrimPrefix(s, "oci://")
+	tag := "latest"
+	if idx := strings.LastIndex(rest, ":"); idx > strings.LastIndex(rest, "/") {
+		tag = rest[idx+1:]
+		rest = rest[:idx]
+	}
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid oci source %q, expected oci://registry/repository[:tag]", s)
+	}
+	registry, repository := parts[0], parts[1]
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tag)
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("fetching manifest for %q returned status %s", s, res.Status)
+	}
+
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&manifest); err != nil {
+		return "", nil, fmt.Errorf("invalid OCI manifest for %q: %v", s, err)
+	}
+
+	blobURL := fmt.Sprintf("https://%s/v2/%s/blobs/%s", registry, repository, manifest.Config.Digest)
+	blobRes, err := http.Get(blobURL)
+	if err != nil {
+		return "", nil, err
+	}
+	defer blobRes.Body.Close()
+	if blobRes.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("fetching config blob for %q returned status %s", s, blobRes.Status)
+	}
+	contents, err := ioutil.ReadAll(io.LimitReader(blobRes.Body, maxRemoteFetchSize))
+	return "", contents, err
+}
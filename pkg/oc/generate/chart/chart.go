@@ -0,0 +1,129 @@
+// Package chart writes a generated Template out as a Helm v3 chart
+// directory, or pushes the same chart as an OCI artifact, so clusters that
+// already distribute workloads through the chart ecosystem can consume an
+// app.json import without a second conversion step.
+package chart
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	templateapi "github.com/openshift/origin/pkg/template/apis/template"
+)
+
+// chartAPIVersion is the Chart.yaml "apiVersion" for Helm v3 charts.
+const chartAPIVersion = "v2"
+
+// paramRef matches the ${PARAM} and ${PARAM_NAME} references Templates use
+// to substitute parameter values into object fields.
+var paramRef = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// chartYAML is the subset of Chart.yaml fields this package populates.
+type chartYAML struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion,omitempty"`
+}
+
+// Write renders template as a Helm v3 chart directory at dir: a Chart.yaml,
+// a values.yaml derived from the Template's Parameters, and one file under
+// templates/ per generated object with ${PARAM} references rewritten to
+// {{ .Values.param }} expressions.
+func Write(dir string, template *templateapi.Template) error {
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0755); err != nil {
+		return fmt.Errorf("unable to create chart directory: %v", err)
+	}
+
+	meta := chartYAML{
+		APIVersion:  chartAPIVersion,
+		Name:        template.Name,
+		Description: template.Annotations["description"],
+		Version:     "0.1.0",
+	}
+	metaYAML, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), metaYAML, 0644); err != nil {
+		return err
+	}
+
+	values := valuesFromParameters(template)
+	valuesYAML, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "values.yaml"), valuesYAML, 0644); err != nil {
+		return err
+	}
+
+	for _, obj := range template.Objects {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("unable to serialize object for chart template: %v", err)
+		}
+		objYAML, err := yaml.JSONToYAML(data)
+		if err != nil {
+			return err
+		}
+		rendered := rewriteParamRefs(string(objYAML))
+
+		name, err := objectFileName(data)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, "templates", name+".yaml")
+		if err := ioutil.WriteFile(path, []byte(rendered), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// valuesFromParameters turns a Template's Parameters into the values.yaml
+// keys that templates/*.yaml's {{ .Values.* }} expressions reference. Keys
+// are lower-cased to match Helm convention; the original parameter Name is
+// what ${PARAM} substitution keys off of, so rewriteParamRefs must agree.
+func valuesFromParameters(template *templateapi.Template) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, p := range template.Parameters {
+		values[strings.ToLower(p.Name)] = p.Value
+	}
+	return values
+}
+
+// rewriteParamRefs replaces every ${PARAM} occurrence with the equivalent
+// Helm template expression referencing values.yaml.
+func rewriteParamRefs(content string) string {
+	return paramRef.ReplaceAllStringFunc(content, func(match string) string {
+		name := paramRef.FindStringSubmatch(match)[1]
+		return fmt.Sprintf("{{ .Values.%s }}", strings.ToLower(name))
+	})
+}
+
+func objectFileName(data []byte) (string, error) {
+	var generic struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return "", err
+	}
+	name := generic.Metadata.Name
+	if len(name) == 0 {
+		name = "object"
+	}
+	return fmt.Sprintf("%s-%s", strings.ToLower(generic.Kind), name), nil
+}
@@ -0,0 +1,380 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ociManifestMediaType and ociConfigMediaType identify the chart artifact
+// using the plain OCI artifact convention (no image config, a single
+// content layer) rather than inventing a new media type.
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.cncf.helm.config.v1+json"
+	ociChartLayerType    = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// PushOCI packages the chart directory at chartDir as a single-layer OCI
+// artifact and pushes it to ref (host/repository:tag), following the same
+// blob-then-manifest upload flow as the standard distribution registry
+// API. It looks up basic-auth credentials for the registry from the ambient
+// docker config (the same file `docker login`/`oc` image pulls populate),
+// and on a 401 response negotiates a bearer token against the challenge in
+// the registry's WWW-Authenticate header, the same two-step flow `docker
+// push` uses. It does not invoke external credential helpers.
+func PushOCI(ref, chartDir string) error {
+	registry, repository, tag, err := splitRef(ref)
+	if err != nil {
+		return err
+	}
+
+	layer, err := tarGzDir(chartDir)
+	if err != nil {
+		return fmt.Errorf("unable to package chart for push: %v", err)
+	}
+	config := []byte("{}")
+
+	username, password := dockerAuthForRegistry(registry)
+	client := &ociClient{registry: registry, repository: repository, username: username, password: password}
+	configDigest, err := client.pushBlob(config)
+	if err != nil {
+		return fmt.Errorf("unable to push chart config: %v", err)
+	}
+	layerDigest, err := client.pushBlob(layer)
+	if err != nil {
+		return fmt.Errorf("unable to push chart layer: %v", err)
+	}
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        ociDescriptor{MediaType: ociConfigMediaType, Digest: configDigest, Size: int64(len(config))},
+		Layers: []ociDescriptor{
+			{MediaType: ociChartLayerType, Digest: layerDigest, Size: int64(len(layer))},
+		},
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return client.pushManifest(tag, manifestJSON)
+}
+
+func splitRef(ref string) (registry, repository, tag string, err error) {
+	tag = "latest"
+	if idx := strings.LastIndex(ref, ":"); idx > strings.LastIndex(ref, "/") {
+		tag = ref[idx+1:]
+		ref = ref[:idx]
+	}
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q, expected host/repository[:tag]", ref)
+	}
+	return parts[0], parts[1], tag, nil
+}
+
+// ociClient speaks just enough of the Docker/OCI distribution API (blob
+// upload and manifest PUT, plus the bearer-token auth handshake registries
+// challenge those with) to push a chart; it intentionally doesn't pull in a
+// full registry client library for this narrow use.
+type ociClient struct {
+	registry   string
+	repository string
+	username   string
+	password   string
+
+	token string
+}
+
+func (c *ociClient) blobURL(digest string) string {
+	return fmt.Sprintf("https://%s/v2/%s/blobs/%s", c.registry, c.repository, digest)
+}
+
+// do sends req, and if the registry challenges it with a 401 carrying a
+// Bearer WWW-Authenticate header, negotiates a token for that challenge and
+// retries the request once with it attached.
+func (c *ociClient) do(req *http.Request) (*http.Response, error) {
+	c.setAuth(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("Www-Authenticate")
+	resp.Body.Close()
+
+	if err := c.authenticate(challenge); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	c.setAuth(retry)
+	return http.DefaultClient.Do(retry)
+}
+
+func (c *ociClient) setAuth(req *http.Request) {
+	switch {
+	case len(c.token) > 0:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case len(c.username) > 0:
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// authenticate parses a "Bearer realm=...,service=...,scope=..." challenge
+// and fetches a token from the realm, authenticating to the token endpoint
+// itself with basic auth if credentials were found for the registry -
+// the same handshake `docker push` performs against token-auth registries
+// like Docker Hub, GHCR and quay.io.
+func (c *ociClient) authenticate(challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("registry requires authentication but did not offer a bearer challenge: %q", challenge)
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	realm := params["realm"]
+	if len(realm) == 0 {
+		return fmt.Errorf("registry auth challenge missing realm: %q", challenge)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, realm, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	if service := params["service"]; len(service) > 0 {
+		q.Set("service", service)
+	}
+	if scope := params["scope"]; len(scope) > 0 {
+		q.Set("scope", scope)
+	}
+	req.URL.RawQuery = q.Encode()
+	if len(c.username) > 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach token endpoint %s: %v", realm, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token endpoint rejected authentication: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("unable to parse token response: %v", err)
+	}
+	c.token = token.Token
+	if len(c.token) == 0 {
+		c.token = token.AccessToken
+	}
+	if len(c.token) == 0 {
+		return fmt.Errorf("token endpoint returned no token")
+	}
+	return nil
+}
+
+func (c *ociClient) pushBlob(data []byte) (string, error) {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+
+	// check if the blob already exists before uploading
+	if headReq, err := http.NewRequest(http.MethodHead, c.blobURL(digest), nil); err == nil {
+		if resp, err := c.do(headReq); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return digest, nil
+			}
+		}
+	}
+
+	startReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://%s/v2/%s/blobs/uploads/", c.registry, c.repository), nil)
+	if err != nil {
+		return "", err
+	}
+	startResp, err := c.do(startReq)
+	if err != nil {
+		return "", err
+	}
+	startResp.Body.Close()
+	if startResp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("registry rejected blob upload start: %s", startResp.Status)
+	}
+	uploadURL := startResp.Header.Get("Location")
+	if len(uploadURL) == 0 {
+		return "", fmt.Errorf("registry did not return an upload location")
+	}
+	if strings.Contains(uploadURL, "?") {
+		uploadURL += "&digest=" + digest
+	} else {
+		uploadURL += "?digest=" + digest
+	}
+
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(data)), nil }
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("registry rejected blob upload: %s", resp.Status)
+	}
+	return digest, nil
+}
+
+func (c *ociClient) pushManifest(tag string, manifest []byte) error {
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", c.registry, c.repository, tag)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(manifest)), nil }
+	req.Header.Set("Content-Type", ociManifestMediaType)
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("registry rejected manifest push: %s", resp.Status)
+	}
+	return nil
+}
+
+// dockerConfig is the subset of ~/.docker/config.json this package reads.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// dockerAuthForRegistry looks up basic-auth credentials for registry from
+// the ambient docker config (honoring $DOCKER_CONFIG, falling back to
+// ~/.docker/config.json), the same file `docker login` writes to and `oc`
+// already reads for image pull/push authentication. It returns empty
+// strings, not an error, when no config or no matching entry exists - the
+// registry may simply not require authentication.
+func dockerAuthForRegistry(registry string) (username, password string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if len(dir) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", ""
+	}
+	entry, ok := cfg.Auths[registry]
+	if !ok {
+		entry, ok = cfg.Auths["https://"+registry]
+	}
+	if !ok || len(entry.Auth) == 0 {
+		return "", ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return "", ""
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// tarGzDir packages dir into a gzip-compressed tar archive, the layout
+// expected of a Helm chart content layer.
+func tarGzDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// chart archives keep every file under a single top-level directory
+		name := filepath.ToSlash(filepath.Join(filepath.Base(dir), rel))
+		hdr := &tar.Header{Name: name, Size: int64(len(contents)), Mode: 0644}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(contents)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,479 @@
+// Package compose converts a docker-compose (v2/v3) file into OpenShift API
+// objects wrapped in a Template.
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kapi "k8s.io/kubernetes/pkg/apis/core"
+
+	appsapi "github.com/openshift/origin/pkg/apps/apis/apps"
+	buildapi "github.com/openshift/origin/pkg/build/apis/build"
+	imageapi "github.com/openshift/origin/pkg/image/apis/image"
+	routeapi "github.com/openshift/origin/pkg/route/apis/route"
+	templateapi "github.com/openshift/origin/pkg/template/apis/template"
+)
+
+// Generator converts a docker-compose file into a Template.
+type Generator struct {
+	// LocalPath is the path to the directory or file the compose file was
+	// read from. Relative secret/config/env_file paths are resolved against
+	// the compose file's directory.
+	LocalPath string
+	// BaseImage is the ONBUILD-capable image used as the base for any
+	// services that declare a build, mirroring the app.json --image flag.
+	BaseImage string
+	// Name is the name to give the generated template and the objects
+	// within it.
+	Name string
+
+	// Warnings collects human readable messages about compose keys that
+	// were recognized but have no Kubernetes/OpenShift analog and were
+	// skipped. They are not fatal - Generate still returns a Template.
+	Warnings []string
+}
+
+// File is the subset of the docker-compose schema this package understands.
+// It is intentionally permissive about the "version" field - the v2 and v3
+// service definitions this package cares about are compatible.
+type File struct {
+	Version  string                 `json:"version"`
+	Services map[string]Service     `json:"services"`
+	Volumes  map[string]interface{} `json:"volumes"`
+	Secrets  map[string]Secret      `json:"secrets"`
+	Configs  map[string]Secret      `json:"configs"`
+}
+
+// Service is a single entry under docker-compose's top level "services" key.
+type Service struct {
+	Image       string           `json:"image"`
+	Build       *Build           `json:"build"`
+	Command     StringOrSlice    `json:"command"`
+	Environment StringMapOrSlice `json:"environment"`
+	EnvFile     StringOrSlice    `json:"env_file"`
+	Ports       []string         `json:"ports"`
+	Volumes     []string         `json:"volumes"`
+	DependsOn   StringOrSlice    `json:"depends_on"`
+	Restart     string           `json:"restart"`
+	NetworkMode string           `json:"network_mode"`
+	Privileged  bool             `json:"privileged"`
+}
+
+// Build is either a bare build context string or the long object form with
+// a context and dockerfile.
+type Build struct {
+	Context    string `json:"context"`
+	Dockerfile string `json:"dockerfile"`
+}
+
+func (b *Build) UnmarshalJSON(data []byte) error {
+	var context string
+	if err := json.Unmarshal(data, &context); err == nil {
+		b.Context = context
+		return nil
+	}
+	type buildAlias Build
+	return json.Unmarshal(data, (*buildAlias)(b))
+}
+
+// Secret models a compose "secrets"/"configs" top level entry backed by a
+// local file, the only form that translates to a Kubernetes Secret without
+// an external secret store.
+type Secret struct {
+	File string `json:"file"`
+}
+
+// StringOrSlice accepts either a bare string or a list of strings, the way
+// compose allows "command: foo bar" or "command: [foo, bar]".
+type StringOrSlice []string
+
+func (s *StringOrSlice) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = strings.Fields(single)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// StringMapOrSlice accepts either a map ("environment: {FOO: bar}") or a
+// list of "KEY=VALUE" strings ("environment: [FOO=bar]").
+type StringMapOrSlice map[string]string
+
+func (s *StringMapOrSlice) UnmarshalJSON(data []byte) error {
+	var asMap map[string]string
+	if err := json.Unmarshal(data, &asMap); err == nil {
+		*s = asMap
+		return nil
+	}
+	var asList []string
+	if err := json.Unmarshal(data, &asList); err != nil {
+		return err
+	}
+	result := map[string]string{}
+	for _, entry := range asList {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			result[parts[0]] = parts[1]
+		} else {
+			result[parts[0]] = ""
+		}
+	}
+	*s = result
+	return nil
+}
+
+// Generate converts the docker-compose file in contents into a Template
+// containing the OpenShift objects it implies.
+func (g *Generator) Generate(contents []byte) (*templateapi.Template, error) {
+	var file File
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("the provided docker-compose file is not valid YAML: %v", err)
+	}
+
+	name := g.Name
+	if len(name) == 0 {
+		name = "app"
+	}
+
+	template := &templateapi.Template{}
+	template.Name = name
+
+	// process names sorted for deterministic output
+	names := make([]string, 0, len(file.Services))
+	for svcName := range file.Services {
+		names = append(names, svcName)
+	}
+	sort.Strings(names)
+
+	for _, svcName := range names {
+		svc := file.Services[svcName]
+		g.addServiceObjects(template, svcName, svc)
+	}
+
+	for volName := range file.Volumes {
+		template.Objects = append(template.Objects, runtime.Object(g.persistentVolumeClaim(volName)))
+	}
+
+	for secretName, secret := range file.Secrets {
+		template.Objects = append(template.Objects, runtime.Object(g.secretFromFile(secretName, secret)))
+	}
+	for configName, config := range file.Configs {
+		template.Objects = append(template.Objects, runtime.Object(g.secretFromFile(configName, config)))
+	}
+
+	return template, nil
+}
+
+func (g *Generator) addServiceObjects(template *templateapi.Template, svcName string, svc Service) {
+	if svc.NetworkMode == "host" {
+		g.warnf("service %q: network_mode: host has no equivalent on restricted clusters and was ignored", svcName)
+	}
+	if svc.Privileged {
+		g.warnf("service %q: privileged containers are not permitted by default and the setting was ignored", svcName)
+	}
+
+	if svc.Build != nil {
+		is, bc := g.buildObjects(svcName, svc)
+		template.Objects = append(template.Objects, runtime.Object(is), runtime.Object(bc))
+	}
+
+	env, params := parameterizedEnvVars(svcName, svc.Environment)
+	template.Parameters = append(template.Parameters, params...)
+
+	var envFrom []kapi.EnvFromSource
+	if secret := g.envFileSecret(svcName, svc); secret != nil {
+		template.Objects = append(template.Objects, runtime.Object(secret))
+		envFrom = append(envFrom, kapi.EnvFromSource{
+			SecretRef: &kapi.SecretEnvSource{LocalObjectReference: kapi.LocalObjectReference{Name: secret.Name}},
+		})
+	}
+
+	dc := g.deploymentConfig(svcName, svc, env, envFrom)
+	g.addVolumeMounts(dc, svcName, svc)
+	template.Objects = append(template.Objects, runtime.Object(dc))
+
+	if len(svc.Ports) > 0 {
+		template.Objects = append(template.Objects, runtime.Object(g.service(svcName, svc)))
+	}
+}
+
+// buildObjects creates the ImageStream/BuildConfig pair used when a service
+// declares a build context, following the same ONBUILD-base convention as
+// the app.json importer's --image flag.
+func (g *Generator) buildObjects(svcName string, svc Service) (*imageapi.ImageStream, *buildapi.BuildConfig) {
+	is := &imageapi.ImageStream{ObjectMeta: metaObject(svcName)}
+
+	context := svc.Build.Context
+	if len(context) == 0 {
+		context = "."
+	}
+	bc := &buildapi.BuildConfig{
+		ObjectMeta: metaObject(svcName),
+		Spec: buildapi.BuildConfigSpec{
+			CommonSpec: buildapi.CommonSpec{
+				Source: buildapi.BuildSource{
+					ContextDir: context,
+					Dockerfile: &svc.Build.Dockerfile,
+				},
+				Strategy: buildapi.BuildStrategy{
+					DockerStrategy: &buildapi.DockerBuildStrategy{},
+				},
+				Output: buildapi.BuildOutput{
+					To: &kapi.ObjectReference{Kind: "ImageStreamTag", Name: svcName + ":latest"},
+				},
+			},
+		},
+	}
+	if len(g.BaseImage) > 0 {
+		bc.Spec.Strategy.DockerStrategy.From = &kapi.ObjectReference{Kind: "DockerImage", Name: g.BaseImage}
+	}
+	return is, bc
+}
+
+func (g *Generator) deploymentConfig(svcName string, svc Service, env []kapi.EnvVar, envFrom []kapi.EnvFromSource) *appsapi.DeploymentConfig {
+	image := svc.Image
+	if len(image) == 0 {
+		// built from an ImageStreamTag produced above
+		image = svcName + ":latest"
+	}
+	container := kapi.Container{
+		Name:    svcName,
+		Image:   image,
+		Command: svc.Command,
+		Env:     env,
+		EnvFrom: envFrom,
+	}
+	for _, portSpec := range svc.Ports {
+		if port, ok := parseContainerPort(portSpec); ok {
+			container.Ports = append(container.Ports, kapi.ContainerPort{ContainerPort: port})
+		}
+	}
+
+	dc := &appsapi.DeploymentConfig{
+		ObjectMeta: metaObject(svcName),
+		Spec: appsapi.DeploymentConfigSpec{
+			Replicas: 1,
+			Selector: map[string]string{"app": svcName},
+			Template: &kapi.PodTemplateSpec{
+				ObjectMeta: metaObject(svcName),
+				Spec: kapi.PodSpec{
+					Containers: []kapi.Container{container},
+				},
+			},
+		},
+	}
+	dc.Spec.Template.Labels = map[string]string{"app": svcName}
+
+	// depends_on has no native ordering primitive on DeploymentConfig; the
+	// best available approximation is an init container per dependency that
+	// blocks until the dependency's service resolves, mirroring what
+	// readiness-gated compose stacks expect in practice.
+	for _, dep := range svc.DependsOn {
+		dc.Spec.Template.Spec.InitContainers = append(dc.Spec.Template.Spec.InitContainers, kapi.Container{
+			Name:    "wait-for-" + dep,
+			Image:   "busybox",
+			Command: []string{"sh", "-c", fmt.Sprintf("until nslookup %s; do sleep 1; done", dep)},
+		})
+	}
+
+	return dc
+}
+
+func (g *Generator) service(svcName string, svc Service) *kapi.Service {
+	s := &kapi.Service{
+		ObjectMeta: metaObject(svcName),
+		Spec: kapi.ServiceSpec{
+			Selector: map[string]string{"app": svcName},
+		},
+	}
+	for _, portSpec := range svc.Ports {
+		port, ok := parseContainerPort(portSpec)
+		if !ok {
+			continue
+		}
+		s.Spec.Ports = append(s.Spec.Ports, kapi.ServicePort{
+			Name:       fmt.Sprintf("port-%d", port),
+			Port:       port,
+			TargetPort: intstr.FromInt(int(port)),
+		})
+	}
+	return s
+}
+
+func (g *Generator) persistentVolumeClaim(volName string) *kapi.PersistentVolumeClaim {
+	return &kapi.PersistentVolumeClaim{
+		ObjectMeta: metaObject(volName),
+		Spec: kapi.PersistentVolumeClaimSpec{
+			AccessModes: []kapi.PersistentVolumeAccessMode{kapi.ReadWriteOnce},
+		},
+	}
+}
+
+func (g *Generator) secretFromFile(name string, secret Secret) *kapi.Secret {
+	s := &kapi.Secret{ObjectMeta: metaObject(name)}
+	if len(secret.File) == 0 {
+		g.warnf("secret/config %q has no \"file\" source and was created empty", name)
+		return s
+	}
+	data, err := ioutil.ReadFile(g.resolvePath(secret.File))
+	if err != nil {
+		g.warnf("secret/config %q: unable to read %q, created empty: %v", name, secret.File, err)
+		return s
+	}
+	s.Data = map[string][]byte{filepath.Base(secret.File): data}
+	return s
+}
+
+// envFileSecret reads each of svc.EnvFile's "KEY=VALUE" files (resolved
+// relative to the compose file, like secretFromFile) into a single Secret
+// consumed through the container's envFrom, merging later files over
+// earlier ones the way compose itself merges a multi-entry env_file list.
+// It returns nil if the service declares no env_file or none of them could
+// be read.
+func (g *Generator) envFileSecret(svcName string, svc Service) *kapi.Secret {
+	if len(svc.EnvFile) == 0 {
+		return nil
+	}
+	data := map[string][]byte{}
+	for _, path := range svc.EnvFile {
+		contents, err := ioutil.ReadFile(g.resolvePath(path))
+		if err != nil {
+			g.warnf("service %q: unable to read env_file %q, it was ignored: %v", svcName, path, err)
+			continue
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			data[parts[0]] = []byte(parts[1])
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return &kapi.Secret{ObjectMeta: metaObject(svcName + "-env"), Data: data}
+}
+
+// resolvePath resolves a compose-file-relative path (a secret/config
+// "file", or an env_file entry) against the directory the compose file
+// itself was read from. Absolute paths, and paths given when the compose
+// file came from a non-local source (LocalPath empty), pass through as-is.
+func (g *Generator) resolvePath(path string) string {
+	if filepath.IsAbs(path) || len(g.LocalPath) == 0 {
+		return path
+	}
+	return filepath.Join(filepath.Dir(g.LocalPath), path)
+}
+
+func (g *Generator) warnf(format string, args ...interface{}) {
+	g.Warnings = append(g.Warnings, fmt.Sprintf(format, args...))
+}
+
+// addVolumeMounts wires a service's "volumes" entries that reference a top
+// level named volume into the DeploymentConfig as a VolumeMount backed by
+// that volume's PersistentVolumeClaim. Bind mounts and anonymous volumes
+// have no equivalent on a restricted cluster and are reported instead of
+// silently dropped.
+func (g *Generator) addVolumeMounts(dc *appsapi.DeploymentConfig, svcName string, svc Service) {
+	container := &dc.Spec.Template.Spec.Containers[0]
+	seen := map[string]bool{}
+	for _, spec := range svc.Volumes {
+		source, target, ok := parseVolumeMount(spec)
+		if !ok {
+			g.warnf("service %q: volume %q is not a SOURCE:TARGET mount and was ignored", svcName, spec)
+			continue
+		}
+		if strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~") {
+			g.warnf("service %q: bind mount %q has no equivalent on restricted clusters and was ignored; declare a named volume under the compose file's top level \"volumes\" instead", svcName, spec)
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, kapi.VolumeMount{Name: source, MountPath: target})
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+		dc.Spec.Template.Spec.Volumes = append(dc.Spec.Template.Spec.Volumes, kapi.Volume{
+			Name: source,
+			VolumeSource: kapi.VolumeSource{
+				PersistentVolumeClaim: &kapi.PersistentVolumeClaimVolumeSource{ClaimName: source},
+			},
+		})
+	}
+}
+
+// parseVolumeMount splits a compose service "volumes" entry ("SOURCE:TARGET"
+// or "SOURCE:TARGET:ro") into its source and target mount path.
+func parseVolumeMount(spec string) (source, target string, ok bool) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func metaObject(name string) kapi.ObjectMeta {
+	return kapi.ObjectMeta{Name: name}
+}
+
+// parseContainerPort extracts the container-side port from a compose ports
+// entry of the form "HOST:CONTAINER", "CONTAINER", or "HOST:CONTAINER/proto".
+func parseContainerPort(spec string) (int32, bool) {
+	spec = strings.SplitN(spec, "/", 2)[0]
+	parts := strings.Split(spec, ":")
+	port, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return 0, false
+	}
+	return int32(port), true
+}
+
+// parameterizedEnvVars turns a service's docker-compose "environment" map
+// into container env vars and the Template Parameters backing them, so the
+// values can be overridden when the Template is processed. Parameter names are namespaced by service (SVCNAME_KEY) so two
+// services that happen to share an env var name don't collide into a single
+// overridable value.
+func parameterizedEnvVars(svcName string, env map[string]string) ([]kapi.EnvVar, []templateapi.Parameter) {
+	if len(env) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vars := make([]kapi.EnvVar, 0, len(keys))
+	params := make([]templateapi.Parameter, 0, len(keys))
+	prefix := strings.ToUpper(parameterNameReplacer.Replace(svcName))
+	for _, k := range keys {
+		paramName := prefix + "_" + k
+		vars = append(vars, kapi.EnvVar{Name: k, Value: fmt.Sprintf("${%s}", paramName)})
+		params = append(params, templateapi.Parameter{Name: paramName, Value: env[k]})
+	}
+	return vars, params
+}
+
+// parameterNameReplacer maps the characters docker-compose allows in a
+// service name (letters, digits, "-", "_", ".") but a Template Parameter
+// name doesn't (only "[A-Za-z0-9_]") onto "_".
+var parameterNameReplacer = strings.NewReplacer("-", "_", ".", "_")
@@ -0,0 +1,233 @@
+// Package overlay implements Helm-style "--set key=val" and "--values file"
+// parameterization for generated Templates, so an importer can be re-run
+// with different values instead of hand-editing the output.
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	templateapi "github.com/openshift/origin/pkg/template/apis/template"
+)
+
+// ParseValues reads a YAML or JSON values file (as accepted by --values)
+// into a nested map, the same shape "--set" flags are parsed into.
+func ParseValues(contents []byte) (map[string]interface{}, error) {
+	if len(contents) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return nil, fmt.Errorf("unable to parse values: %v", err)
+	}
+	return values, nil
+}
+
+// ParseSet parses repeatable "--set foo=bar,baz.qux=1" flags into a single
+// nested map, the way Helm's --set does. Later flags win over earlier ones
+// on conflicting keys.
+func ParseSet(sets []string) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for _, set := range sets {
+		for _, assignment := range strings.Split(set, ",") {
+			if len(assignment) == 0 {
+				continue
+			}
+			parts := strings.SplitN(assignment, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid --set value %q, expected key=value", assignment)
+			}
+			setPath(result, strings.Split(parts[0], "."), inferValue(parts[1]))
+		}
+	}
+	return result, nil
+}
+
+// Merge overlays src onto dst, recursing into nested maps and otherwise
+// letting src win. dst is mutated and returned.
+func Merge(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = Merge(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// ApplyParameters overrides the Value of any Template Parameter whose Name
+// matches a top level values key, case-insensitively, mirroring how
+// app.json env vars surface as Parameters. It returns the names that did
+// not match any parameter so the caller can decide whether to warn.
+func ApplyParameters(template *templateapi.Template, values map[string]interface{}) []string {
+	var unmatched []string
+	for key, value := range values {
+		if _, isMap := value.(map[string]interface{}); isMap || value == nil {
+			// nested maps are object overlays, not parameter values
+			continue
+		}
+		str := fmt.Sprintf("%v", value)
+		matched := false
+		for i := range template.Parameters {
+			if strings.EqualFold(template.Parameters[i].Name, key) {
+				template.Parameters[i].Value = str
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, key)
+		}
+	}
+	return unmatched
+}
+
+// ApplyObjects patches fields directly into the generated objects, for
+// overrides that don't correspond to a Template Parameter (e.g.
+// "deploymentconfigs.web.spec.replicas=3"). The first path segment selects
+// objects by Kind - either the Kind itself or its naively-pluralized,
+// lower-cased resource form, matching the "kind" and "resource" spellings
+// users already use with `oc get` - the second by metadata.name, and the
+// remainder is a dotted path into that object's JSON representation. Callers
+// must run this after the objects have been converted to versioned form
+// (e.g. via app.AsVersionedObjects), since TypeMeta.Kind is otherwise empty
+// and nothing would ever match. This is a plain field overlay rather than a
+// true strategic merge (no list patch-merge-key support), which covers the
+// scalar overrides --set is meant for.
+func ApplyObjects(objects []runtime.Object, overlay map[string]interface{}) ([]runtime.Object, error) {
+	for kind, byKind := range overlay {
+		fields, ok := byKind.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, byName := range fields {
+			patch, ok := byName.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if err := patchObject(objects, kind, name, patch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return objects, nil
+}
+
+func patchObject(objects []runtime.Object, kind, name string, patch map[string]interface{}) error {
+	for i, obj := range objects {
+		accessor, err := objectNameAndKind(obj)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(accessor.kind, kind) && !strings.EqualFold(pluralize(accessor.kind), kind) {
+			continue
+		}
+		if accessor.name != name {
+			continue
+		}
+		merged, err := mergeIntoObject(obj, patch)
+		if err != nil {
+			return fmt.Errorf("unable to apply --set overlay to %s/%s: %v", kind, name, err)
+		}
+		objects[i] = merged
+	}
+	return nil
+}
+
+// pluralize turns a Kind into the lower-cased resource-style plural users
+// type with `oc get` (DeploymentConfig -> deploymentconfigs, Service ->
+// services). It's the naive English "+s"/"+es" rule kubectl's own resource
+// aliasing falls back to for kinds it doesn't special-case, which is enough
+// for the object kinds this importer generates.
+func pluralize(kind string) string {
+	lower := strings.ToLower(kind)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "ch"):
+		return lower + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return lower[:len(lower)-1] + "ies"
+	default:
+		return lower + "s"
+	}
+}
+
+type nameAndKind struct {
+	name string
+	kind string
+}
+
+// objectNameAndKind extracts the metadata.name and kind from a runtime
+// object by round-tripping through JSON, avoiding a dependency on the full
+// scheme/meta accessor machinery for this narrow lookup.
+func objectNameAndKind(obj runtime.Object) (nameAndKind, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nameAndKind{}, err
+	}
+	var generic struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nameAndKind{}, err
+	}
+	return nameAndKind{name: generic.Metadata.Name, kind: generic.Kind}, nil
+}
+
+func mergeIntoObject(obj runtime.Object, patch map[string]interface{}) (runtime.Object, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	Merge(generic, patch)
+	merged, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	out := obj.DeepCopyObject()
+	if err := json.Unmarshal(merged, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 1 {
+		m[path[0]] = value
+		return
+	}
+	next, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		next = map[string]interface{}{}
+		m[path[0]] = next
+	}
+	setPath(next, path[1:], value)
+}
+
+// inferValue converts a --set scalar to a bool/number when it unambiguously
+// parses as one, and leaves it as a string otherwise - the same convention
+// Helm's --set uses.
+func inferValue(s string) interface{} {
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	return s
+}